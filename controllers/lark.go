@@ -0,0 +1,49 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"io"
+
+	"github.com/casdoor/casdoor/object"
+)
+
+// LarkWebhook
+// @Tag Lark API
+// @Title LarkWebhook
+// @Description handle a Lark contact event-subscription delivery for one provider
+// @Param providerName path string true "the name of the Lark provider"
+// @router /webhook/lark/:providerName [post]
+func (c *ApiController) LarkWebhook() {
+	providerName := c.Ctx.Input.Param(":providerName")
+
+	body, err := io.ReadAll(c.Ctx.Request.Body)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	resp, err := object.HandleLarkEvent(providerName, body,
+		c.Ctx.Input.Header("X-Lark-Signature"),
+		c.Ctx.Input.Header("X-Lark-Request-Timestamp"),
+		c.Ctx.Input.Header("X-Lark-Request-Nonce"))
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.Ctx.Output.Header("Content-Type", "application/json")
+	_, _ = c.Ctx.ResponseWriter.Write(resp)
+}
@@ -0,0 +1,37 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"github.com/casdoor/casdoor/object"
+)
+
+// SyncUsers
+// @Tag Lark API
+// @Title SyncUsers
+// @Description pre-provision Casdoor accounts and groups from a Lark tenant's contacts
+// @Param providerName path string true "the name of the Lark provider"
+// @router /sync-users/:providerName [post]
+func (c *ApiController) SyncUsers() {
+	providerName := c.Ctx.Input.Param(":providerName")
+
+	count, err := object.SyncLarkUsers(providerName)
+	if err != nil {
+		c.ResponseError(err.Error())
+		return
+	}
+
+	c.ResponseOk(count)
+}
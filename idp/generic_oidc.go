@@ -0,0 +1,190 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// defaultClockSkew is how long past its exp a token is still accepted by the verifier,
+// matching the leniency most OIDC libraries apply by default.
+const defaultClockSkew = 5 * time.Minute
+
+// defaultJwksCacheTtl is how long a discovered JWKS is reused before GenericOidcIdProvider
+// re-fetches it, when the caller doesn't pass an explicit TTL.
+const defaultJwksCacheTtl = 1 * time.Hour
+
+// ttlKeySet wraps an oidc.RemoteKeySet and rebuilds it once ttl has elapsed since the last
+// fetch, instead of relying on the JWKS endpoint's own Cache-Control headers. A ttl of zero
+// fetches a fresh keyset on every build (no caching).
+type ttlKeySet struct {
+	ctx     context.Context
+	jwksURL string
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	inner     oidc.KeySet
+	fetchedAt time.Time
+}
+
+func newTtlKeySet(ctx context.Context, jwksURL string, ttl time.Duration) *ttlKeySet {
+	return &ttlKeySet{ctx: ctx, jwksURL: jwksURL, ttl: ttl}
+}
+
+func (k *ttlKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	k.mu.Lock()
+	if k.inner == nil || time.Since(k.fetchedAt) > k.ttl {
+		k.inner = oidc.NewRemoteKeySet(k.ctx, k.jwksURL)
+		k.fetchedAt = time.Now()
+	}
+	keySet := k.inner
+	k.mu.Unlock()
+
+	return keySet.VerifySignature(ctx, jwt)
+}
+
+type GenericOidcIdProvider struct {
+	Client    *http.Client
+	Config    *oauth2.Config
+	Issuer    string
+	ClockSkew time.Duration
+
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewGenericOidcIdProvider performs OIDC discovery against issuer (fetching
+// `/.well-known/openid-configuration`) and builds an IdProvider that verifies the id_token
+// returned by the token endpoint instead of trusting the userinfo response outright.
+// jwksCacheTtl bounds how long the discovered JWKS is reused before being re-fetched
+// (defaulting to defaultJwksCacheTtl when zero); clockSkew bounds how long past exp a token
+// is still accepted, defaulting to defaultClockSkew when zero.
+func NewGenericOidcIdProvider(clientId, clientSecret, redirectUrl, issuer string, jwksCacheTtl, clockSkew time.Duration) (*GenericOidcIdProvider, error) {
+	if clockSkew == 0 {
+		clockSkew = defaultClockSkew
+	}
+	if jwksCacheTtl == 0 {
+		jwksCacheTtl = defaultJwksCacheTtl
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	ctx := oidc.ClientContext(context.Background(), client)
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("NewGenericOidcIdProvider() error: %v", err)
+	}
+
+	var discovery struct {
+		JwksUri string `json:"jwks_uri"`
+	}
+	if err = provider.Claims(&discovery); err != nil {
+		return nil, fmt.Errorf("NewGenericOidcIdProvider() error reading jwks_uri: %v", err)
+	}
+
+	var endpoint oauth2.Endpoint
+	endpoint.AuthURL = provider.Endpoint().AuthURL
+	endpoint.TokenURL = provider.Endpoint().TokenURL
+
+	idp := &GenericOidcIdProvider{
+		Client: client,
+		Config: &oauth2.Config{
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email", "groups"},
+			Endpoint:     endpoint,
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectUrl,
+		},
+		Issuer:    issuer,
+		ClockSkew: clockSkew,
+		provider:  provider,
+	}
+
+	keySet := newTtlKeySet(ctx, discovery.JwksUri, jwksCacheTtl)
+	idp.verifier = oidc.NewVerifier(issuer, keySet, &oidc.Config{
+		ClientID: clientId,
+		Now:      func() time.Time { return time.Now().Add(-clockSkew) },
+	})
+
+	return idp, nil
+}
+
+func (idp *GenericOidcIdProvider) SetHttpClient(client *http.Client) {
+	idp.Client = client
+	idp.Config.Endpoint = idp.provider.Endpoint()
+}
+
+// GetToken uses code to get token
+func (idp *GenericOidcIdProvider) GetToken(code string) (*oauth2.Token, error) {
+	ctx := oidc.ClientContext(context.Background(), idp.Client)
+	return idp.Config.Exchange(ctx, code)
+}
+
+// GetUserInfo verifies the id_token minted alongside token (signature, aud, iss, exp) and
+// maps its standard claims into a UserInfo, so a compromised or replayed access token cannot
+// be used to forge a login on its own.
+func (idp *GenericOidcIdProvider) GetUserInfo(token *oauth2.Token) (*UserInfo, error) {
+	rawIdToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIdToken == "" {
+		return nil, fmt.Errorf("GetUserInfo() error: token response has no id_token")
+	}
+
+	idToken, err := idp.verifier.Verify(oidc.ClientContext(context.Background(), idp.Client), rawIdToken)
+	if err != nil {
+		return nil, fmt.Errorf("GetUserInfo() error verifying id_token: %v", err)
+	}
+
+	var claims struct {
+		Sub               string   `json:"sub"`
+		Email             string   `json:"email"`
+		EmailVerified     bool     `json:"email_verified"`
+		PreferredUsername string   `json:"preferred_username"`
+		Picture           string   `json:"picture"`
+		Groups            []string `json:"groups"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("GetUserInfo() error parsing id_token claims: %v", err)
+	}
+
+	return &UserInfo{
+		Id:          claims.Sub,
+		Username:    claims.PreferredUsername,
+		DisplayName: claims.PreferredUsername,
+		Email:       claims.Email,
+		AvatarUrl:   claims.Picture,
+		Extra: map[string]string{
+			"emailVerified": fmt.Sprintf("%t", claims.EmailVerified),
+			"groups":        fmt.Sprintf("%v", claims.Groups),
+		},
+	}, nil
+}
+
+// newIdTokenVerifier builds an oidc.IDTokenVerifier bound to clientId, accepting tokens up to
+// clockSkew past exp. LarkIdProvider uses it when Lark returns an id_token. It applies the same
+// ClientID and clock-skew checks as GenericOidcIdProvider's verifier, but over the provider's
+// own remote keyset rather than a TTL-bounded ttlKeySet.
+func newIdTokenVerifier(provider *oidc.Provider, clientId string, clockSkew time.Duration) *oidc.IDTokenVerifier {
+	return provider.Verifier(&oidc.Config{
+		ClientID: clientId,
+		Now:      func() time.Time { return time.Now().Add(-clockSkew) },
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idp
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// IdProvider is the interface every third-party login provider (Lark, GitHub, Google, ...)
+// implements so the object layer can drive them all the same way.
+type IdProvider interface {
+	SetHttpClient(client *http.Client)
+	GetToken(code string) (*oauth2.Token, error)
+	GetUserInfo(token *oauth2.Token) (*UserInfo, error)
+}
+
+// RefreshableIdProvider is implemented by providers whose access token can be renewed without
+// sending the user through the OAuth dance again. LarkIdProvider implements it so long-lived
+// API access (Bitable, calendar, etc.) keeps working past the 2-hour user access token
+// lifetime; providers with no refresh endpoint simply don't implement it.
+type RefreshableIdProvider interface {
+	IdProvider
+	RefreshToken(token *oauth2.Token) (*oauth2.Token, error)
+}
+
+// UserInfo is the normalized profile every IdProvider.GetUserInfo returns. Extra carries
+// provider-specific identifiers and tokens (e.g. Lark's open_id/union_id and refresh token)
+// that the object layer persists on the linked user record.
+type UserInfo struct {
+	Id          string
+	Username    string
+	DisplayName string
+	UnionId     string
+	Email       string
+	Phone       string
+	CountryCode string
+	AvatarUrl   string
+	Extra       map[string]string
+}
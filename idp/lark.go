@@ -15,6 +15,7 @@
 package idp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,13 +23,20 @@ import (
 	"strings"
 	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
 )
 
+// larkOidcIssuer is Lark/Feishu's OIDC issuer, used to discover the JWKS endpoint that
+// verifies id_tokens returned by `/authen/v1/oidc/access_token`.
+const larkOidcIssuer = "https://open.feishu.cn"
+
 type LarkIdProvider struct {
 	Client     *http.Client
 	Config     *oauth2.Config
 	UserIdType string
+
+	oidcVerifier *oidc.IDTokenVerifier
 }
 
 func NewLarkIdProvider(clientId, clientSecret, redirectUrl, userIdType string) *LarkIdProvider {
@@ -93,7 +101,10 @@ func (idp *LarkIdProvider) GetToken(code string) (*oauth2.Token, error) {
 		Expiry:      time.Now().Add(time.Second * time.Duration(appToken.Expire)),
 	}
 
-	return token.WithExtra(map[string]interface{}{"code": code}), nil
+	return token.WithExtra(map[string]interface{}{
+		"code":                code,
+		"tenant_access_token": appToken.TenantAccessToken,
+	}), nil
 }
 
 /*
@@ -121,6 +132,7 @@ type LarkUserAccessToken struct {
 		ExpiresIn        int    `json:"expires_in"`
 		RefreshExpiresIn int    `json:"refresh_expires_in"`
 		Scope            string `json:"scope"`
+		IdToken          string `json:"id_token"`
 	} `json:"data"`
 }
 
@@ -175,7 +187,63 @@ func (idp *LarkIdProvider) GetUserInfo(token *oauth2.Token) (*UserInfo, error) {
 		return nil, err
 	}
 
-	return idp.requestUserInfo(userAccessToken)
+	userInfo, err := idp.requestUserInfo(userAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lark's userinfo endpoint is trusted on the strength of the access_token alone. When an
+	// id_token is present, verify it with the shared OIDC verifier so a compromised
+	// app_access_token can't be used to replay a fake userinfo payload.
+	if userAccessToken.Data.IdToken != "" {
+		if err = idp.verifyIdTokenSubject(userAccessToken.Data.IdToken, userInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	return userInfo, nil
+}
+
+// verifyIdTokenSubject verifies the signature, audience, issuer and expiry of rawIdToken
+// using the shared go-oidc verifier, then checks that its `sub` claim matches the open_id or
+// union_id already extracted from the userinfo response.
+func (idp *LarkIdProvider) verifyIdTokenSubject(rawIdToken string, userInfo *UserInfo) error {
+	verifier, err := idp.getOidcVerifier()
+	if err != nil {
+		return err
+	}
+
+	idToken, err := verifier.Verify(oidc.ClientContext(context.Background(), idp.Client), rawIdToken)
+	if err != nil {
+		return fmt.Errorf("GetUserInfo() error verifying id_token: %v", err)
+	}
+
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err = idToken.Claims(&claims); err != nil {
+		return fmt.Errorf("GetUserInfo() error parsing id_token claims: %v", err)
+	}
+
+	if claims.Sub != userInfo.Extra["larkOpenId"] && claims.Sub != userInfo.Extra["larkUnionId"] {
+		return fmt.Errorf("GetUserInfo() error: id_token subject %q does not match the user returned by userinfo", claims.Sub)
+	}
+
+	return nil
+}
+
+func (idp *LarkIdProvider) getOidcVerifier() (*oidc.IDTokenVerifier, error) {
+	if idp.oidcVerifier == nil {
+		ctx := oidc.ClientContext(context.Background(), idp.Client)
+		provider, err := oidc.NewProvider(ctx, larkOidcIssuer)
+		if err != nil {
+			return nil, fmt.Errorf("getOidcVerifier() error discovering Lark OIDC issuer: %v", err)
+		}
+
+		idp.oidcVerifier = newIdTokenVerifier(provider, idp.Config.ClientID, defaultClockSkew)
+	}
+
+	return idp.oidcVerifier, nil
 }
 
 func (idp *LarkIdProvider) requestUserAccessToken(token *oauth2.Token) (*LarkUserAccessToken, error) {
@@ -215,7 +283,74 @@ func (idp *LarkIdProvider) requestUserInfo(userAccessToken *LarkUserAccessToken)
 	}
 	defer resp.Body.Close()
 
-	return idp.parseUserInfo(resp.Body)
+	userInfo, err := idp.parseUserInfo(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stash the refresh token alongside the access token so it can be persisted on the
+	// linked user record and later handed back to RefreshToken() to keep long-lived API
+	// access (Bitable, calendar, etc.) working without sending the user through OAuth again.
+	userInfo.Extra["larkAccessToken"] = userAccessToken.Data.AccessToken
+	userInfo.Extra["larkRefreshToken"] = userAccessToken.Data.RefreshToken
+	userInfo.Extra["larkAccessTokenExpireAt"] = time.Now().Add(time.Second * time.Duration(userAccessToken.Data.ExpiresIn)).Format(time.RFC3339)
+	userInfo.Extra["larkRefreshTokenExpireAt"] = time.Now().Add(time.Second * time.Duration(userAccessToken.Data.RefreshExpiresIn)).Format(time.RFC3339)
+
+	return userInfo, nil
+}
+
+// RefreshToken exchanges a previously-issued refresh_token for a new user access token via
+// Lark's `/authen/v1/oidc/refresh_access_token` endpoint, using a freshly obtained
+// app_access_token to authenticate the call. It lets callers renew a user's Lark access
+// before it expires instead of forcing them through the full OAuth dance again.
+func (idp *LarkIdProvider) RefreshToken(token *oauth2.Token) (*oauth2.Token, error) {
+	if token.RefreshToken == "" {
+		return nil, fmt.Errorf("RefreshToken() error: token has no refresh_token")
+	}
+
+	appToken, err := idp.GetToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": token.RefreshToken,
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := idp.createRequest("POST", "https://open.feishu.cn/open-apis/authen/v1/oidc/refresh_access_token", data, appToken.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := idp.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	userAccessToken, err := idp.parseUserAccessToken(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if userAccessToken.Code != 0 {
+		return nil, fmt.Errorf("RefreshToken() error, userAccessToken.Code: %d, userAccessToken.Msg: %s", userAccessToken.Code, userAccessToken.Msg)
+	}
+
+	newToken := &oauth2.Token{
+		AccessToken:  userAccessToken.Data.AccessToken,
+		RefreshToken: userAccessToken.Data.RefreshToken,
+		TokenType:    userAccessToken.Data.TokenType,
+		Expiry:       time.Now().Add(time.Second * time.Duration(userAccessToken.Data.ExpiresIn)),
+	}
+
+	return newToken, nil
 }
 
 func (idp *LarkIdProvider) createRequest(method, url string, body []byte, accessToken string) (*http.Request, error) {
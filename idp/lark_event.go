@@ -0,0 +1,323 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// larkNonceTtl bounds how long a (timestamp, nonce) pair is remembered for replay
+// rejection; Lark retries undelivered events for at most an hour.
+const larkNonceTtl = time.Hour
+
+/*
+{
+    "encrypt": "c2VjcmV0..."
+}
+*/
+
+type larkEncryptedEvent struct {
+	Encrypt string `json:"encrypt"`
+}
+
+/*
+{
+    "schema": "2.0",
+    "header": {
+        "event_id": "5e3702a---",
+        "event_type": "contact.user.updated_v3",
+        "token": "rvaYgkND1GOiu--",
+        "create_time": "1608725989000",
+        "tenant_key": "736588c92lxf175d"
+    },
+    "event": {
+        "object": {
+            "open_id": "ou-xxx",
+            "union_id": "on-xxx",
+            "status": {"is_activated": true, "is_frozen": false, "is_resigned": false}
+        },
+        "old_object": {"status": {"is_activated": false}}
+    }
+}
+*/
+
+type larkEventUserStatus struct {
+	IsActivated bool `json:"is_activated"`
+	IsFrozen    bool `json:"is_frozen"`
+	IsResigned  bool `json:"is_resigned"`
+}
+
+type LarkEvent struct {
+	Schema string `json:"schema"`
+	Header struct {
+		EventId    string `json:"event_id"`
+		EventType  string `json:"event_type"`
+		Token      string `json:"token"`
+		CreateTime string `json:"create_time"`
+		TenantKey  string `json:"tenant_key"`
+	} `json:"header"`
+	Event struct {
+		Object struct {
+			OpenId           string              `json:"open_id"`
+			UnionId          string              `json:"union_id"`
+			Name             string              `json:"name"`
+			DepartmentId     string              `json:"department_id"`
+			OpenDepartmentId string              `json:"open_department_id"`
+			Status           larkEventUserStatus `json:"status"`
+		} `json:"object"`
+		// OldObject only carries the fields that actually changed, so a nil Status means
+		// this update left activation/freeze/resignation untouched (e.g. only mobile or
+		// name changed) and must not be treated as a deactivation.
+		OldObject struct {
+			Status *larkEventUserStatus `json:"status"`
+		} `json:"old_object"`
+	} `json:"event"`
+}
+
+/*
+{
+    "type": "url_verification",
+    "challenge": "xxx",
+    "token": "xxx"
+}
+*/
+
+type larkUrlVerificationRequest struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Token     string `json:"token"`
+}
+
+// LarkEventSink is implemented by the object layer to react to a Lark contact event once
+// LarkEventHandler has authenticated and decoded it. larkUnionId/larkOpenId match the
+// `UserInfo.Extra` values that identify the linked Casdoor user.
+type LarkEventSink interface {
+	DisableUser(larkUnionId, larkOpenId string) error
+	DeleteUser(larkUnionId, larkOpenId string) error
+	RenameGroup(departmentId, name string) error
+}
+
+// LarkEventHandler authenticates and decodes Lark contact event-subscription callbacks for
+// one provider, then dispatches them to a LarkEventSink. EncryptKey/VerificationToken come
+// from that provider's config, making the whole webhook opt-in per tenant.
+type LarkEventHandler struct {
+	ProviderName      string
+	EncryptKey        string
+	VerificationToken string
+	Sink              LarkEventSink
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func NewLarkEventHandler(providerName, encryptKey, verificationToken string, sink LarkEventSink) *LarkEventHandler {
+	return &LarkEventHandler{
+		ProviderName:      providerName,
+		EncryptKey:        encryptKey,
+		VerificationToken: verificationToken,
+		Sink:              sink,
+		nonces:            map[string]time.Time{},
+	}
+}
+
+// HandleRequest verifies and decodes one webhook delivery. If it is Lark's one-time URL
+// verification challenge, the raw challenge response body is returned with a nil error;
+// callers should write it back as-is. Otherwise the decoded event is dispatched to the Sink
+// and HandleRequest returns the empty-object body Lark expects on success.
+func (h *LarkEventHandler) HandleRequest(body []byte, signature, timestamp, nonce string) ([]byte, error) {
+	// With neither credential set there is nothing to authenticate a delivery against, so the
+	// webhook must stay disabled rather than silently trust every caller.
+	if h.EncryptKey == "" && h.VerificationToken == "" {
+		return nil, fmt.Errorf("HandleRequest() error: provider has no EncryptKey/VerificationToken configured, webhook is disabled")
+	}
+
+	plaintext, err := h.decryptBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge larkUrlVerificationRequest
+	if err = json.Unmarshal(plaintext, &challenge); err == nil && challenge.Type == "url_verification" {
+		if !tokenMatches(challenge.Token, h.VerificationToken) {
+			return nil, fmt.Errorf("HandleRequest() error: url_verification token mismatch")
+		}
+		return json.Marshal(map[string]string{"challenge": challenge.Challenge})
+	}
+
+	if err = h.verifySignature(signature, timestamp, nonce, body); err != nil {
+		return nil, err
+	}
+	if err = h.checkReplay(timestamp, nonce); err != nil {
+		return nil, err
+	}
+
+	var event LarkEvent
+	if err = json.Unmarshal(plaintext, &event); err != nil {
+		return nil, fmt.Errorf("HandleRequest() error unmarshalling event: %v", err)
+	}
+
+	// The body is only guaranteed to be signed (verifySignature above) when EncryptKey is set;
+	// every event, encrypted or not, also carries header.token, so check it unconditionally.
+	if !tokenMatches(event.Header.Token, h.VerificationToken) {
+		return nil, fmt.Errorf("HandleRequest() error: event token mismatch")
+	}
+
+	if err = h.dispatch(&event); err != nil {
+		return nil, err
+	}
+
+	return []byte("{}"), nil
+}
+
+func tokenMatches(got, want string) bool {
+	if want == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+func (h *LarkEventHandler) dispatch(event *LarkEvent) error {
+	object := event.Event.Object
+	unionId := object.UnionId
+	openId := object.OpenId
+
+	switch event.Header.EventType {
+	case "contact.user.updated_v3", "contact.user.updated":
+		// contact.user.updated fires on any field change (name, mobile, department, ...).
+		// Only react when the diff actually touched activation/freeze/resignation, and only
+		// disable the user once that status has transitioned to inactive.
+		if event.Event.OldObject.Status == nil {
+			return nil
+		}
+		isInactive := !object.Status.IsActivated || object.Status.IsFrozen || object.Status.IsResigned
+		if !isInactive {
+			return nil
+		}
+		return h.Sink.DisableUser(unionId, openId)
+	case "contact.user.deleted_v3", "contact.user.deleted":
+		return h.Sink.DeleteUser(unionId, openId)
+	case "contact.department.updated_v3", "contact.department.updated":
+		departmentId := object.DepartmentId
+		if departmentId == "" {
+			departmentId = object.OpenDepartmentId
+		}
+		return h.Sink.RenameGroup(departmentId, object.Name)
+	default:
+		return nil
+	}
+}
+
+// decryptBody AES-256-CBC decrypts body's `encrypt` field with EncryptKey, returning body
+// unchanged when EncryptKey is empty (encryption is opt-in per Lark event subscription).
+func (h *LarkEventHandler) decryptBody(body []byte) ([]byte, error) {
+	if h.EncryptKey == "" {
+		return body, nil
+	}
+
+	var encrypted larkEncryptedEvent
+	if err := json.Unmarshal(body, &encrypted); err != nil || encrypted.Encrypt == "" {
+		return nil, fmt.Errorf("decryptBody() error: request is not an encrypted Lark event")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.Encrypt)
+	if err != nil {
+		return nil, fmt.Errorf("decryptBody() error decoding base64: %v", err)
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("decryptBody() error: ciphertext too short")
+	}
+
+	key := sha256.Sum256([]byte(h.EncryptKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("decryptBody() error creating cipher: %v", err)
+	}
+
+	iv := ciphertext[:aes.BlockSize]
+	ciphertext = ciphertext[aes.BlockSize:]
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("decryptBody() error: ciphertext is not a multiple of the block size")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	return unpadPKCS7(plaintext)
+}
+
+func unpadPKCS7(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("unpadPKCS7() error: empty plaintext")
+	}
+
+	padLen := int(data[len(data)-1])
+	if padLen == 0 || padLen > len(data) {
+		return nil, fmt.Errorf("unpadPKCS7() error: invalid padding")
+	}
+
+	return data[:len(data)-padLen], nil
+}
+
+// verifySignature checks Lark's `X-Lark-Signature` header, a plain SHA-256 hex digest of
+// timestamp+nonce+encryptKey+body (not an HMAC), to confirm the delivery really came from
+// Lark.
+func (h *LarkEventHandler) verifySignature(signature, timestamp, nonce string, body []byte) error {
+	if h.EncryptKey == "" {
+		return nil
+	}
+
+	sum := sha256.New()
+	sum.Write([]byte(timestamp + nonce + h.EncryptKey))
+	sum.Write(body)
+	expected := hex.EncodeToString(sum.Sum(nil))
+
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+		return fmt.Errorf("verifySignature() error: X-Lark-Signature mismatch")
+	}
+
+	return nil
+}
+
+// checkReplay rejects a (timestamp, nonce) pair that has already been processed, and prunes
+// entries older than larkNonceTtl so the cache doesn't grow unbounded.
+func (h *LarkEventHandler) checkReplay(timestamp, nonce string) error {
+	key := timestamp + ":" + nonce
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if seenAt, ok := h.nonces[key]; ok && now.Sub(seenAt) < larkNonceTtl {
+		return fmt.Errorf("checkReplay() error: duplicate event delivery")
+	}
+
+	h.nonces[key] = now
+	for k, seenAt := range h.nonces {
+		if now.Sub(seenAt) >= larkNonceTtl {
+			delete(h.nonces, k)
+		}
+	}
+
+	return nil
+}
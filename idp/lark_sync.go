@@ -0,0 +1,284 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+const larkSyncPageSize = "50"
+
+/*
+{
+    "code": 0,
+    "msg": "success",
+    "data": {
+        "items": [
+            {
+                "user_id": "5d9bdxxx",
+                "union_id": "on-d89jhsdhjsajkda7828enjdj328ydhhw3u43yjhdj",
+                "open_id": "ou-caecc734c2e3328a62489fe0648c4b98779515d3",
+                "name": "zhangsan",
+                "en_name": "zhangsan",
+                "email": "zhangsan@feishu.cn",
+                "mobile": "+86130002883xx",
+                "avatar": {"avatar_origin": "www.feishu.cn/avatar/icon"},
+                "department_ids": ["od-xxx"],
+                "status": {"is_activated": true, "is_frozen": false, "is_resigned": false}
+            }
+        ],
+        "page_token": "xxx",
+        "has_more": false
+    }
+}
+*/
+
+type LarkContactUser struct {
+	UserId        string   `json:"user_id"`
+	UnionId       string   `json:"union_id"`
+	OpenId        string   `json:"open_id"`
+	Name          string   `json:"name"`
+	EnName        string   `json:"en_name"`
+	Email         string   `json:"email"`
+	Mobile        string   `json:"mobile"`
+	DepartmentIds []string `json:"department_ids"`
+	Avatar        struct {
+		AvatarOrigin string `json:"avatar_origin"`
+	} `json:"avatar"`
+	Status struct {
+		IsActivated bool `json:"is_activated"`
+		IsFrozen    bool `json:"is_frozen"`
+		IsResigned  bool `json:"is_resigned"`
+	} `json:"status"`
+}
+
+type larkContactUserListResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Items     []LarkContactUser `json:"items"`
+		PageToken string            `json:"page_token"`
+		HasMore   bool              `json:"has_more"`
+	} `json:"data"`
+}
+
+/*
+{
+    "code": 0,
+    "msg": "success",
+    "data": {
+        "items": [
+            {
+                "department_id": "od-xxx",
+                "parent_department_id": "0",
+                "name": "Engineering",
+                "open_department_id": "od-yyy"
+            }
+        ],
+        "page_token": "xxx",
+        "has_more": false
+    }
+}
+*/
+
+type LarkContactDepartment struct {
+	DepartmentId       string `json:"department_id"`
+	OpenDepartmentId   string `json:"open_department_id"`
+	ParentDepartmentId string `json:"parent_department_id"`
+	Name               string `json:"name"`
+}
+
+type larkContactDepartmentListResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data struct {
+		Items     []LarkContactDepartment `json:"items"`
+		PageToken string                  `json:"page_token"`
+		HasMore   bool                    `json:"has_more"`
+	} `json:"data"`
+}
+
+// SyncUsers returns every member of the tenant. `/contact/v3/users/find_by_department` only
+// ever returns the direct members of the department passed to it, so department_id=0 alone
+// would silently drop everyone in a sub-department; SyncUsers first walks the department tree
+// via SyncGroups, then pages through find_by_department once per department (plus the root),
+// deduping members who show up under more than one department.
+func (idp *LarkIdProvider) SyncUsers(tenantAccessToken string) ([]LarkContactUser, error) {
+	departments, err := idp.SyncGroups(tenantAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	useOpenDepartmentId := idp.getSyncDepartmentIdType() == "open_department_id"
+
+	departmentIds := []string{"0"}
+	for _, department := range departments {
+		if useOpenDepartmentId {
+			departmentIds = append(departmentIds, department.OpenDepartmentId)
+		} else {
+			departmentIds = append(departmentIds, department.DepartmentId)
+		}
+	}
+
+	seen := map[string]bool{}
+	var users []LarkContactUser
+	for _, departmentId := range departmentIds {
+		departmentUsers, err := idp.syncUsersByDepartment(tenantAccessToken, departmentId)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range departmentUsers {
+			key := user.UserId + "|" + user.OpenId + "|" + user.UnionId
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// syncUsersByDepartment pages through the direct members of one department via
+// `/contact/v3/users/find_by_department`, using tenantAccessToken (the `tenant_access_token`
+// returned alongside the app token in GetToken's Extra).
+func (idp *LarkIdProvider) syncUsersByDepartment(tenantAccessToken, departmentId string) ([]LarkContactUser, error) {
+	var users []LarkContactUser
+
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("user_id_type", idp.getSyncUserIdType())
+		query.Set("department_id_type", idp.getSyncDepartmentIdType())
+		query.Set("department_id", departmentId)
+		query.Set("page_size", larkSyncPageSize)
+		if pageToken != "" {
+			query.Set("page_token", pageToken)
+		}
+
+		req, err := idp.createRequest("GET", "https://open.feishu.cn/open-apis/contact/v3/users/find_by_department?"+query.Encode(), nil, tenantAccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := idp.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var listResp larkContactUserListResponse
+		err = idp.decodeResponse(resp.Body, &listResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if listResp.Code != 0 {
+			return nil, fmt.Errorf("SyncUsers() error, code: %d, msg: %s", listResp.Code, listResp.Msg)
+		}
+
+		users = append(users, listResp.Data.Items...)
+
+		if !listResp.Data.HasMore || listResp.Data.PageToken == "" {
+			break
+		}
+		pageToken = listResp.Data.PageToken
+	}
+
+	return users, nil
+}
+
+// SyncGroups walks Lark's `/contact/v3/departments` endpoint page by page using
+// tenantAccessToken and returns every department of the tenant, so they can be mapped to
+// Casdoor groups.
+func (idp *LarkIdProvider) SyncGroups(tenantAccessToken string) ([]LarkContactDepartment, error) {
+	var departments []LarkContactDepartment
+
+	pageToken := ""
+	for {
+		query := url.Values{}
+		query.Set("department_id_type", idp.getSyncDepartmentIdType())
+		query.Set("page_size", larkSyncPageSize)
+		if pageToken != "" {
+			query.Set("page_token", pageToken)
+		}
+
+		req, err := idp.createRequest("GET", "https://open.feishu.cn/open-apis/contact/v3/departments?"+query.Encode(), nil, tenantAccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := idp.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var listResp larkContactDepartmentListResponse
+		err = idp.decodeResponse(resp.Body, &listResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if listResp.Code != 0 {
+			return nil, fmt.Errorf("SyncGroups() error, code: %d, msg: %s", listResp.Code, listResp.Msg)
+		}
+
+		departments = append(departments, listResp.Data.Items...)
+
+		if !listResp.Data.HasMore || listResp.Data.PageToken == "" {
+			break
+		}
+		pageToken = listResp.Data.PageToken
+	}
+
+	return departments, nil
+}
+
+// getSyncUserIdType maps the configured UserIdType onto the `user_id_type` query parameter
+// Lark's contact API expects, defaulting to open_id.
+func (idp *LarkIdProvider) getSyncUserIdType() string {
+	switch idp.UserIdType {
+	case "union_id":
+		return "union_id"
+	case "user_id":
+		return "user_id"
+	default:
+		return "open_id"
+	}
+}
+
+// getSyncDepartmentIdType maps the configured UserIdType onto the `department_id_type` query
+// parameter, a separate id space from user_id_type that only accepts department_id or
+// open_department_id. UserIdType == "user_id" has no department-id analogue, so it also falls
+// back to the tenant-internal department_id, matching LarkContactDepartment.DepartmentId.
+func (idp *LarkIdProvider) getSyncDepartmentIdType() string {
+	if idp.UserIdType == "union_id" {
+		return "open_department_id"
+	}
+	return "department_id"
+}
+
+func (idp *LarkIdProvider) decodeResponse(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idp
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProviderConfig is the subset of a Casdoor provider's config GetIdProvider needs to build
+// any IdProvider, including the generic OIDC one added alongside Lark's id_token
+// verification.
+type ProviderConfig struct {
+	Type         string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	UserIdType   string
+
+	// Issuer, JwksCacheTtl and ClockSkew only apply to Type == "GenericOidc".
+	Issuer       string
+	JwksCacheTtl time.Duration
+	ClockSkew    time.Duration
+}
+
+// GetIdProvider builds the IdProvider for cfg.Type. Only "Lark" and "GenericOidc" are
+// handled here; any other type returns an unsupported-provider error.
+func GetIdProvider(cfg *ProviderConfig) (IdProvider, error) {
+	switch cfg.Type {
+	case "Lark":
+		return NewLarkIdProvider(cfg.ClientId, cfg.ClientSecret, cfg.RedirectUrl, cfg.UserIdType), nil
+	case "GenericOidc":
+		return NewGenericOidcIdProvider(cfg.ClientId, cfg.ClientSecret, cfg.RedirectUrl, cfg.Issuer, cfg.JwksCacheTtl, cfg.ClockSkew)
+	default:
+		return nil, fmt.Errorf("GetIdProvider() error: unsupported provider type: %s", cfg.Type)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"github.com/casdoor/casdoor/util"
+)
+
+// Group is the subset of Casdoor's group model the Lark department sync depends on.
+// SourceId holds the upstream department_id so a department can be found again on later
+// syncs and webhook-driven renames without relying on its (mutable) display name.
+type Group struct {
+	Owner       string `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name        string `xorm:"varchar(100) notnull pk" json:"name"`
+	DisplayName string `xorm:"varchar(100)" json:"displayName"`
+	ParentId    string `xorm:"varchar(100)" json:"parentId"`
+	SourceId    string `xorm:"varchar(100) index" json:"sourceId"`
+}
+
+func (group *Group) GetId() string {
+	return group.Owner + "/" + group.Name
+}
+
+// GetGroupBySourceId finds the group previously synced from a Lark department_id, returning
+// (nil, nil) if it hasn't been synced yet.
+func GetGroupBySourceId(owner, sourceId string) (*Group, error) {
+	group := Group{}
+
+	existed, err := adapter.Engine.Where("owner = ? and source_id = ?", owner, sourceId).Get(&group)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		return nil, nil
+	}
+
+	return &group, nil
+}
+
+// AddGroup inserts a group synced from a Lark department.
+func AddGroup(group *Group) (bool, error) {
+	affected, err := adapter.Engine.Insert(group)
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}
+
+// UpdateGroup persists the given columns of group, matching the (owner, name) the rest of the
+// object package already uses to address a group.
+func UpdateGroup(id string, group *Group, columns []string) (bool, error) {
+	owner, name := util.GetOwnerAndNameFromId(id)
+
+	affected, err := adapter.Engine.ID([]string{owner, name}).Cols(columns...).Update(group)
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/casdoor/casdoor/idp"
+)
+
+var larkSyncCronOnce sync.Once
+
+// larkSyncedUserType marks a Casdoor account as pre-provisioned from a Lark tenant's contact
+// directory rather than created on first login.
+const larkSyncedUserType = "lark-synced"
+
+// larkSyncCronInterval is how often RunLarkSyncCron re-syncs every provider it was started
+// for.
+const larkSyncCronInterval = 1 * time.Hour
+
+// SyncLarkUsers pre-provisions Casdoor accounts and groups from providerName's Lark tenant:
+// departments are mapped to groups, then every contact is upserted as a User of type
+// "lark-synced", preserving the avatar/email/mobile fields idp.LarkIdProvider already
+// extracts. It returns the number of users created or updated.
+func SyncLarkUsers(providerName string) (int, error) {
+	provider, err := GetProvider(providerName)
+	if err != nil {
+		return 0, err
+	}
+	if provider == nil {
+		return 0, fmt.Errorf("SyncLarkUsers() error: provider %q not found", providerName)
+	}
+
+	larkIdProvider := idp.NewLarkIdProvider(provider.ClientId, provider.ClientSecret, "", provider.UserMapping["userIdType"])
+	larkIdProvider.SetHttpClient(&http.Client{Timeout: 10 * time.Second})
+
+	token, err := larkIdProvider.GetToken("")
+	if err != nil {
+		return 0, err
+	}
+	tenantAccessToken, _ := token.Extra("tenant_access_token").(string)
+
+	departments, err := larkIdProvider.SyncGroups(tenantAccessToken)
+	if err != nil {
+		return 0, err
+	}
+	for _, department := range departments {
+		if err = upsertGroupFromLarkDepartment(provider.Owner, department); err != nil {
+			return 0, err
+		}
+	}
+
+	users, err := larkIdProvider.SyncUsers(tenantAccessToken)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, larkUser := range users {
+		if err = upsertUserFromLarkContact(provider.Owner, larkUser); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+func upsertGroupFromLarkDepartment(owner string, department idp.LarkContactDepartment) error {
+	group, err := GetGroupBySourceId(owner, department.DepartmentId)
+	if err != nil {
+		return err
+	}
+
+	if group == nil {
+		group = &Group{
+			Owner:       owner,
+			Name:        fmt.Sprintf("lark-%s", department.DepartmentId),
+			DisplayName: department.Name,
+			SourceId:    department.DepartmentId,
+		}
+		_, err = AddGroup(group)
+		return err
+	}
+
+	if group.DisplayName == department.Name {
+		return nil
+	}
+
+	group.DisplayName = department.Name
+	_, err = UpdateGroup(group.GetId(), group, []string{"display_name"})
+	return err
+}
+
+func upsertUserFromLarkContact(owner string, contact idp.LarkContactUser) error {
+	user, err := GetUserByLarkId(owner, contact.UnionId, contact.OpenId)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		user = &User{
+			Owner:       owner,
+			Name:        fmt.Sprintf("lark-%s", contact.OpenId),
+			Type:        larkSyncedUserType,
+			LarkUnionId: contact.UnionId,
+			LarkOpenId:  contact.OpenId,
+			Properties:  map[string]string{},
+		}
+		applyLarkContact(user, contact)
+		_, err = AddUser(user)
+		return err
+	}
+
+	applyLarkContact(user, contact)
+	_, err = UpdateUser(user.GetId(), user, []string{"display_name", "avatar", "email", "phone", "is_forbidden", "properties"})
+	return err
+}
+
+func applyLarkContact(user *User, contact idp.LarkContactUser) {
+	user.DisplayName = contact.Name
+	user.Avatar = contact.Avatar.AvatarOrigin
+	user.Email = contact.Email
+	user.Phone = contact.Mobile
+	user.IsForbidden = !contact.Status.IsActivated || contact.Status.IsFrozen || contact.Status.IsResigned
+	if user.Properties == nil {
+		user.Properties = map[string]string{}
+	}
+}
+
+// RunLarkSyncCron re-syncs providerName's Lark tenant on larkSyncCronInterval, so accounts
+// and groups stay pre-provisioned without an admin re-triggering SyncLarkUsers by hand. It
+// never returns; start it once per synced provider with `go object.RunLarkSyncCron(name)`.
+func RunLarkSyncCron(providerName string) {
+	for {
+		if _, err := SyncLarkUsers(providerName); err != nil {
+			logs.Error("RunLarkSyncCron(%s) error: %v", providerName, err)
+		}
+		time.Sleep(larkSyncCronInterval)
+	}
+}
+
+// InitLarkSyncCron starts RunLarkSyncCron for every Lark provider in the database, exactly
+// once per process. Call it from main.go's startup sequence, alongside the other object.Init*
+// calls, so pre-provisioning actually keeps running instead of sitting unused.
+func InitLarkSyncCron() error {
+	var err error
+	larkSyncCronOnce.Do(func() {
+		var providers []*Provider
+		if err = adapter.Engine.Where("type = ?", "Lark").Find(&providers); err != nil {
+			return
+		}
+
+		for _, provider := range providers {
+			go RunLarkSyncCron(provider.GetId())
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/astaxie/beego/logs"
+	"github.com/casdoor/casdoor/idp"
+	"golang.org/x/oauth2"
+)
+
+var larkTokenRenewalOnce sync.Once
+
+// InitLarkTokenRenewal starts RunLarkTokenRenewal's background loop exactly once per process.
+// Call it from main.go's startup sequence, alongside the other object.Init* calls, so the
+// renewal loop actually runs instead of sitting unused.
+func InitLarkTokenRenewal() {
+	larkTokenRenewalOnce.Do(func() {
+		go RunLarkTokenRenewal()
+	})
+}
+
+// PersistLarkTokens copies the Lark refresh-token fields idp.LarkIdProvider.GetUserInfo
+// stashed in userInfo.Extra onto the Casdoor user linked to that Lark account, and records
+// which provider they came from. Callers should invoke this right after a successful Lark
+// login, alongside whatever already creates/updates the user from userInfo; without it
+// renewExpiringLarkTokens has nothing to renew.
+func PersistLarkTokens(owner, providerName string, userInfo *idp.UserInfo) error {
+	user, err := GetUserByLarkId(owner, userInfo.Extra["larkUnionId"], userInfo.Extra["larkOpenId"])
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	if user.Properties == nil {
+		user.Properties = map[string]string{}
+	}
+	user.Properties["larkProvider"] = providerName
+	user.Properties["larkAccessToken"] = userInfo.Extra["larkAccessToken"]
+	user.Properties["larkRefreshToken"] = userInfo.Extra["larkRefreshToken"]
+	user.Properties["larkAccessTokenExpireAt"] = userInfo.Extra["larkAccessTokenExpireAt"]
+	user.Properties["larkRefreshTokenExpireAt"] = userInfo.Extra["larkRefreshTokenExpireAt"]
+
+	_, err = UpdateUser(user.GetId(), user, []string{"properties"})
+	return err
+}
+
+// larkRenewalCheckInterval is how often RunLarkTokenRenewal wakes up to look for lark-linked
+// users whose access token is close to expiring.
+const larkRenewalCheckInterval = 10 * time.Minute
+
+// larkRenewalLeadTime is how far ahead of the stored expiry a token gets renewed, so API
+// calls never race a token that's about to lapse.
+const larkRenewalLeadTime = 30 * time.Minute
+
+// RunLarkTokenRenewal is a small renewal loop: it periodically refreshes every lark-linked
+// user's access token shortly before expiry via LarkIdProvider.RefreshToken, so long-lived
+// API access to Lark (Bitable, calendar, etc.) keeps working without sending the user through
+// OAuth again. It never returns; start it once with `go object.RunLarkTokenRenewal()`.
+func RunLarkTokenRenewal() {
+	for {
+		if err := renewExpiringLarkTokens(); err != nil {
+			logs.Error("RunLarkTokenRenewal() error: %v", err)
+		}
+		time.Sleep(larkRenewalCheckInterval)
+	}
+}
+
+func renewExpiringLarkTokens() error {
+	// larkRefreshToken is only ever set by PersistLarkTokens, on users who actually completed
+	// a Lark OAuth login; lark-synced directory users never obtain one. The LIKE is a coarse
+	// pre-filter on the serialized properties column, refined below by parsing the real value.
+	var users []*User
+	err := adapter.Engine.Where("properties like ?", "%larkRefreshToken%").Find(&users)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(larkRenewalLeadTime)
+	for _, user := range users {
+		if user.Properties["larkRefreshToken"] == "" {
+			continue
+		}
+
+		expireAt, err := time.Parse(time.RFC3339, user.Properties["larkAccessTokenExpireAt"])
+		if err != nil || expireAt.After(cutoff) {
+			continue
+		}
+
+		if err = renewLarkUserToken(user); err != nil {
+			logs.Error("renewLarkUserToken(%s) error: %v", user.GetId(), err)
+		}
+	}
+
+	return nil
+}
+
+func renewLarkUserToken(user *User) error {
+	providerName := user.Properties["larkProvider"]
+	if providerName == "" || user.Properties["larkRefreshToken"] == "" {
+		return nil
+	}
+
+	provider, err := GetProvider(providerName)
+	if err != nil || provider == nil {
+		return err
+	}
+
+	larkIdProvider := idp.NewLarkIdProvider(provider.ClientId, provider.ClientSecret, "", provider.UserMapping["userIdType"])
+	larkIdProvider.SetHttpClient(&http.Client{Timeout: 10 * time.Second})
+
+	newToken, err := larkIdProvider.RefreshToken(&oauth2.Token{RefreshToken: user.Properties["larkRefreshToken"]})
+	if err != nil {
+		return err
+	}
+
+	user.Properties["larkAccessToken"] = newToken.AccessToken
+	user.Properties["larkRefreshToken"] = newToken.RefreshToken
+	user.Properties["larkAccessTokenExpireAt"] = newToken.Expiry.Format(time.RFC3339)
+
+	_, err = UpdateUser(user.GetId(), user, []string{"properties"})
+	return err
+}
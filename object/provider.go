@@ -0,0 +1,59 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"github.com/casdoor/casdoor/util"
+)
+
+// Provider is the subset of Casdoor's provider config this package's Lark integration
+// depends on: the OAuth credentials used to drive idp.LarkIdProvider, plus the two fields
+// that make the event-subscription webhook opt-in per tenant.
+type Provider struct {
+	Owner string `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name  string `xorm:"varchar(100) notnull pk" json:"name"`
+	Type  string `xorm:"varchar(100)" json:"type"`
+
+	ClientId     string            `xorm:"varchar(1000)" json:"clientId"`
+	ClientSecret string            `xorm:"varchar(3000)" json:"clientSecret"`
+	UserMapping  map[string]string `xorm:"varchar(1000)" json:"userMapping"`
+
+	// EncryptKey/VerificationToken are Lark's event-subscription credentials, set in the
+	// provider's "Encrypt Key" / "Verification Token" fields. Leaving them blank keeps the
+	// `/api/webhook/lark/:providerName` endpoint disabled for that tenant.
+	EncryptKey        string `xorm:"varchar(100)" json:"encryptKey"`
+	VerificationToken string `xorm:"varchar(100)" json:"verificationToken"`
+}
+
+func (provider *Provider) GetId() string {
+	return provider.Owner + "/" + provider.Name
+}
+
+// GetProvider reads one provider by its "owner/name" id, returning (nil, nil) if it doesn't
+// exist.
+func GetProvider(id string) (*Provider, error) {
+	owner, name := util.GetOwnerAndNameFromId(id)
+	provider := Provider{Owner: owner, Name: name}
+
+	existed, err := adapter.Engine.Get(&provider)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		return nil, nil
+	}
+
+	return &provider, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 The Casdoor Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package object
+
+import (
+	"github.com/casdoor/casdoor/util"
+)
+
+// User is the subset of Casdoor's user model the Lark integration depends on: the per-user
+// Lark linkage (set from UserInfo.Extra on login/sync) and the properties bag other OAuth
+// providers already use to stash provider-specific extras.
+type User struct {
+	Owner string `xorm:"varchar(100) notnull pk" json:"owner"`
+	Name  string `xorm:"varchar(100) notnull pk" json:"name"`
+
+	Type        string `xorm:"varchar(100)" json:"type"`
+	DisplayName string `xorm:"varchar(100)" json:"displayName"`
+	Avatar      string `xorm:"varchar(500)" json:"avatar"`
+	Email       string `xorm:"varchar(100) index" json:"email"`
+	Phone       string `xorm:"varchar(100) index" json:"phone"`
+	IsForbidden bool   `json:"isForbidden"`
+
+	LarkUnionId string            `xorm:"varchar(100) index" json:"larkUnionId"`
+	LarkOpenId  string            `xorm:"varchar(100) index" json:"larkOpenId"`
+	Properties  map[string]string `xorm:"varchar(5000)" json:"properties"`
+}
+
+func (user *User) GetId() string {
+	return user.Owner + "/" + user.Name
+}
+
+// GetUserByLarkId finds the Casdoor user linked to a Lark account by union_id or open_id,
+// returning (nil, nil) if neither matches.
+func GetUserByLarkId(owner, larkUnionId, larkOpenId string) (*User, error) {
+	user := User{}
+
+	existed, err := adapter.Engine.Where("owner = ? and (lark_union_id = ? or lark_open_id = ?)", owner, larkUnionId, larkOpenId).Get(&user)
+	if err != nil {
+		return nil, err
+	}
+	if !existed {
+		return nil, nil
+	}
+
+	return &user, nil
+}
+
+// UpdateUser persists the given columns of user, matching the (owner, name) the rest of the
+// object package already uses to address a user.
+func UpdateUser(id string, user *User, columns []string) (bool, error) {
+	owner, name := util.GetOwnerAndNameFromId(id)
+
+	affected, err := adapter.Engine.ID([]string{owner, name}).Cols(columns...).Update(user)
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}
+
+// AddUser inserts a newly synced or linked Lark user.
+func AddUser(user *User) (bool, error) {
+	affected, err := adapter.Engine.Insert(user)
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}
+
+// DeleteUser removes user, used when Lark reports the account as deleted.
+func DeleteUser(user *User) (bool, error) {
+	affected, err := adapter.Engine.ID([]string{user.Owner, user.Name}).Delete(&User{})
+	if err != nil {
+		return false, err
+	}
+
+	return affected != 0, nil
+}